@@ -0,0 +1,208 @@
+package pksigner
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+
+	"github.com/miekg/pkcs11"
+)
+
+// namedCurveOIDs maps the ASN.1 OID encoded in CKA_EC_PARAMS to the Go
+// elliptic.Curve it names. PKCS#11 only requires we support the curves our
+// tokens actually carry, so this is deliberately limited to the NIST curves
+// PIV (and most HSMs) issue.
+var namedCurveOIDs = map[string]elliptic.Curve{
+	"1.2.840.10045.3.1.7": elliptic.P256(),
+	"1.3.132.0.34":        elliptic.P384(),
+	"1.3.132.0.35":        elliptic.P521(),
+}
+
+// ed25519CurveOID is the CKA_EC_PARAMS OID PKCS#11 v3.0 uses to mark an
+// Ed25519 key (RFC 8032's id-Ed25519).
+const ed25519CurveOID = "1.3.101.112"
+
+// ckkECEdwards and ckmEDDSA are the PKCS#11 v3.0 CKK_EC_EDWARDS key type and
+// CKM_EDDSA mechanism, per the OASIS PKCS#11 v3.0 specification. They're
+// defined locally because github.com/miekg/pkcs11 (as of v1.1.2) only
+// vendors PKCS#11 v2.40 constants and doesn't have Edwards/EdDSA symbols
+// yet; these values track what upstream would add them as.
+const (
+	ckkECEdwards = 0x00000040
+	ckmEDDSA     = 0x00001057
+)
+
+// ecdsaSignature is the ASN.1 structure crypto/ecdsa.Verify expects,
+// wrapping the raw r||s PKCS#11 hands back from CKM_ECDSA.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// parseECPoint decodes a CKA_EC_POINT attribute value, which is a
+// DER-encoded OCTET STRING wrapping the uncompressed EC point
+// (0x04 || X || Y).
+func parseECPoint(curve elliptic.Curve, value []byte) (x, y *big.Int, err error) {
+	var octet []byte
+	if _, err := asn1.Unmarshal(value, &octet); err != nil {
+		return nil, nil, fmt.Errorf("pkcs11: failed to parse CKA_EC_POINT: %s", err)
+	}
+
+	x, y = elliptic.Unmarshal(curve, octet)
+	if x == nil {
+		return nil, nil, fmt.Errorf("pkcs11: CKA_EC_POINT is not an uncompressed point")
+	}
+	return x, y, nil
+}
+
+// curveFromECParams decodes a CKA_EC_PARAMS attribute value, a DER-encoded
+// named-curve OID, into the Go elliptic.Curve it identifies.
+func curveFromECParams(value []byte) (elliptic.Curve, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(value, &oid); err != nil {
+		return nil, fmt.Errorf("pkcs11: failed to parse CKA_EC_PARAMS: %s", err)
+	}
+
+	curve, ok := namedCurveOIDs[oid.String()]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: unsupported named curve %s", oid.String())
+	}
+	return curve, nil
+}
+
+// isEd25519Params reports whether a CKA_EC_PARAMS value encodes the
+// id-Ed25519 OID rather than one of the NIST named curves.
+func isEd25519Params(value []byte) bool {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(value, &oid); err != nil {
+		return false
+	}
+	return oid.String() == ed25519CurveOID
+}
+
+// ecParamsIndicateEd25519 reports whether attributes carry a CKA_EC_PARAMS
+// encoding the id-Ed25519 OID, the way PKCS#11 v2.40 tokens (predating
+// CKK_EC_EDWARDS) mark an Ed25519 key that otherwise reports plain CKK_EC.
+func ecParamsIndicateEd25519(attributes []*pkcs11.Attribute) bool {
+	for _, attribute := range attributes {
+		if attribute.Type == pkcs11.CKA_EC_PARAMS {
+			return isEd25519Params(attribute.Value)
+		}
+	}
+	return false
+}
+
+// isEd25519Key is the session-bound counterpart of ecParamsIndicateEd25519,
+// for callers that only have a key handle and need to fetch CKA_EC_PARAMS
+// themselves.
+func (s *Store) isEd25519Key(session pkcs11.SessionHandle, handle pkcs11.ObjectHandle) bool {
+	attrs, err := s.context.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+	})
+	if err != nil || len(attrs) != 1 {
+		return false
+	}
+	return isEd25519Params(attrs[0].Value)
+}
+
+// createECDSAPubkeyFromAttributes builds an ecdsa.PublicKey from the
+// CKA_EC_PARAMS and CKA_EC_POINT attributes of an EC public or private key
+// object.
+func createECDSAPubkeyFromAttributes(attributes []*pkcs11.Attribute) (*ecdsa.PublicKey, error) {
+	var params, point []byte
+	for _, attribute := range attributes {
+		switch attribute.Type {
+		case pkcs11.CKA_EC_PARAMS:
+			params = attribute.Value
+		case pkcs11.CKA_EC_POINT:
+			point = attribute.Value
+		}
+	}
+	if params == nil || point == nil {
+		return nil, fmt.Errorf("pkcs11: EC key is missing CKA_EC_PARAMS or CKA_EC_POINT")
+	}
+
+	curve, err := curveFromECParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	x, y, err := parseECPoint(curve, point)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// createEd25519PubkeyFromAttributes builds an ed25519.PublicKey from the
+// CKA_EC_POINT attribute of an Ed25519 public or private key object.
+func createEd25519PubkeyFromAttributes(attributes []*pkcs11.Attribute) (ed25519.PublicKey, error) {
+	var point []byte
+	for _, attribute := range attributes {
+		if attribute.Type == pkcs11.CKA_EC_POINT {
+			point = attribute.Value
+		}
+	}
+	if point == nil {
+		return nil, fmt.Errorf("pkcs11: Ed25519 key is missing CKA_EC_POINT")
+	}
+
+	var raw []byte
+	if _, err := asn1.Unmarshal(point, &raw); err != nil {
+		return nil, fmt.Errorf("pkcs11: failed to parse CKA_EC_POINT: %s", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("pkcs11: Ed25519 public key has unexpected length %d", len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// signECDSA has the HSM sign the raw digest with CKM_ECDSA, then wraps the
+// r||s output PKCS#11 returns into the ASN.1 SEQUENCE{ r, s INTEGER } that
+// crypto/ecdsa.Verify expects.
+func (s *Store) signECDSA(session pkcs11.SessionHandle, privateKey pkcs11.ObjectHandle, digest []byte) ([]byte, error) {
+	if err := s.context.SignInit(
+		session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)},
+		privateKey,
+	); err != nil {
+		return nil, err
+	}
+
+	raw, err := s.context.Sign(session, digest)
+	if err != nil {
+		return nil, err
+	}
+	return wrapECDSASignature(raw)
+}
+
+// wrapECDSASignature converts the raw r||s bytes CKM_ECDSA returns into the
+// ASN.1 SEQUENCE{ r, s INTEGER } that crypto/ecdsa.Verify expects.
+func wrapECDSASignature(raw []byte) ([]byte, error) {
+	if len(raw)%2 != 0 {
+		return nil, fmt.Errorf("pkcs11: CKM_ECDSA signature has odd length %d", len(raw))
+	}
+	half := len(raw) / 2
+
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(raw[:half]),
+		S: new(big.Int).SetBytes(raw[half:]),
+	})
+}
+
+// signEdDSA has the HSM sign the message with CKM_EDDSA, returning the raw
+// 64-byte signature. Ed25519 is always used in "pure" mode, so `message` is
+// the original message, not a hash of it.
+func (s *Store) signEdDSA(session pkcs11.SessionHandle, privateKey pkcs11.ObjectHandle, message []byte) ([]byte, error) {
+	if err := s.context.SignInit(
+		session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(ckmEDDSA, nil)},
+		privateKey,
+	); err != nil {
+		return nil, err
+	}
+	return s.context.Sign(session, message)
+}
@@ -0,0 +1,154 @@
+package pksigner
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+)
+
+func TestParseECPoint(t *testing.T) {
+	curve := elliptic.P256()
+	x, y := curve.Params().Gx, curve.Params().Gy
+	point := elliptic.Marshal(curve, x, y)
+	der, err := asn1.Marshal(point)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotX, gotY, err := parseECPoint(curve, der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotX.Cmp(x) != 0 || gotY.Cmp(y) != 0 {
+		t.Fatalf("parseECPoint returned (%v, %v), want (%v, %v)", gotX, gotY, x, y)
+	}
+}
+
+func TestParseECPointRejectsGarbage(t *testing.T) {
+	if _, _, err := parseECPoint(elliptic.P256(), []byte{0x01, 0x02}); err == nil {
+		t.Fatal("expected an error for malformed CKA_EC_POINT")
+	}
+}
+
+func TestCurveFromECParams(t *testing.T) {
+	for oidStr, want := range namedCurveOIDs {
+		oid, err := stringToOID(oidStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := asn1.Marshal(oid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := curveFromECParams(der)
+		if err != nil {
+			t.Fatalf("curveFromECParams(%s): %s", oidStr, err)
+		}
+		if got != want {
+			t.Fatalf("curveFromECParams(%s) = %v, want %v", oidStr, got, want)
+		}
+	}
+}
+
+func TestCurveFromECParamsUnsupported(t *testing.T) {
+	oid, err := stringToOID("1.2.3.4.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := curveFromECParams(der); err == nil {
+		t.Fatal("expected an error for an unsupported curve OID")
+	}
+}
+
+func TestIsEd25519Params(t *testing.T) {
+	ed25519OID, err := stringToOID(ed25519CurveOID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519DER, err := asn1.Marshal(ed25519OID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEd25519Params(ed25519DER) {
+		t.Fatal("isEd25519Params should be true for the Ed25519 OID")
+	}
+
+	p256OID, err := stringToOID("1.2.840.10045.3.1.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256DER, err := asn1.Marshal(p256OID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isEd25519Params(p256DER) {
+		t.Fatal("isEd25519Params should be false for a NIST curve OID")
+	}
+}
+
+func TestEcParamsIndicateEd25519(t *testing.T) {
+	ed25519OID, err := stringToOID(ed25519CurveOID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519DER, err := asn1.Marshal(ed25519OID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, ed25519DER)}
+	if !ecParamsIndicateEd25519(attrs) {
+		t.Fatal("ecParamsIndicateEd25519 should be true for a CKK_EC key carrying the Ed25519 OID")
+	}
+
+	p256OID, err := stringToOID("1.2.840.10045.3.1.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256DER, err := asn1.Marshal(p256OID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs = []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, p256DER)}
+	if ecParamsIndicateEd25519(attrs) {
+		t.Fatal("ecParamsIndicateEd25519 should be false for a NIST curve OID")
+	}
+
+	if ecParamsIndicateEd25519(nil) {
+		t.Fatal("ecParamsIndicateEd25519 should be false when CKA_EC_PARAMS is absent")
+	}
+}
+
+func TestWrapECDSASignature(t *testing.T) {
+	raw := make([]byte, 64)
+	raw[31] = 0x2a // r = 42
+	raw[63] = 0x07 // s = 7
+
+	der, err := wrapECDSASignature(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sig ecdsaSignature
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		t.Fatal(err)
+	}
+	if sig.R.Cmp(big.NewInt(42)) != 0 || sig.S.Cmp(big.NewInt(7)) != 0 {
+		t.Fatalf("got r=%v s=%v, want r=42 s=7", sig.R, sig.S)
+	}
+}
+
+func TestWrapECDSASignatureOddLength(t *testing.T) {
+	if _, err := wrapECDSASignature([]byte{0x01, 0x02, 0x03}); err == nil {
+		t.Fatal("expected an error for an odd-length signature")
+	}
+}
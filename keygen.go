@@ -0,0 +1,259 @@
+package pksigner
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/miekg/pkcs11"
+)
+
+// KeyLabels names and identifies a key pair being generated or an object
+// being imported, mirroring the CKA_LABEL/CKA_ID pair Config uses to find
+// one again later.
+type KeyLabels struct {
+	// Label is stored as CKA_LABEL on the generated private (and public)
+	// key object.
+	Label string
+
+	// ID is stored as CKA_ID on the generated private (and public) key
+	// object, so a certificate can be bound to it later with
+	// ImportCertificate.
+	ID []byte
+}
+
+// privateKeyAttributes returns the CKA_TOKEN/CKA_PRIVATE/CKA_SIGN/
+// CKA_SENSITIVE template (with CKA_EXTRACTABLE false) shared by every key
+// type GenerateRSA and GenerateECDSA create, plus the
+// CKA_LABEL/CKA_ID pair identifying it.
+func privateKeyAttributes(labels KeyLabels) []*pkcs11.Attribute {
+	attrs := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+	}
+	if labels.Label != "" {
+		attrs = append(attrs, pkcs11.NewAttribute(pkcs11.CKA_LABEL, labels.Label))
+	}
+	if labels.ID != nil {
+		attrs = append(attrs, pkcs11.NewAttribute(pkcs11.CKA_ID, labels.ID))
+	}
+	return attrs
+}
+
+// publicKeyAttributes returns the CKA_TOKEN/CKA_VERIFY template shared by
+// every key type's public half, plus the same CKA_LABEL/CKA_ID pair as its
+// private half.
+func publicKeyAttributes(labels KeyLabels) []*pkcs11.Attribute {
+	attrs := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+	}
+	if labels.Label != "" {
+		attrs = append(attrs, pkcs11.NewAttribute(pkcs11.CKA_LABEL, labels.Label))
+	}
+	if labels.ID != nil {
+		attrs = append(attrs, pkcs11.NewAttribute(pkcs11.CKA_ID, labels.ID))
+	}
+	return attrs
+}
+
+// GenerateRSA has the HSM generate a new RSA key pair with CKM_RSA_PKCS_KEY_PAIR_GEN,
+// labeled and identified by labels, and returns the public half.
+func (s *Store) GenerateRSA(bits int, labels KeyLabels) (crypto.PublicKey, error) {
+	publicTemplate := append(publicKeyAttributes(labels),
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, uint(bits)),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{0x01, 0x00, 0x01}),
+	)
+	privateTemplate := privateKeyAttributes(labels)
+
+	session, err := s.openRWSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.context.CloseSession(session)
+
+	publicHandle, _, err := s.context.GenerateKeyPair(
+		session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)},
+		publicTemplate,
+		privateTemplate,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := s.context.GetAttributeValue(session, publicHandle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return createRSAPubkeyFromAttributes(attrs), nil
+}
+
+// GenerateECDSA has the HSM generate a new EC key pair with CKM_EC_KEY_PAIR_GEN,
+// labeled and identified by labels, and returns the public half.
+func (s *Store) GenerateECDSA(curve elliptic.Curve, labels KeyLabels) (crypto.PublicKey, error) {
+	params, err := curveToECParams(curve)
+	if err != nil {
+		return nil, err
+	}
+
+	publicTemplate := append(publicKeyAttributes(labels),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+	)
+	privateTemplate := privateKeyAttributes(labels)
+
+	session, err := s.openRWSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.context.CloseSession(session)
+
+	publicHandle, _, err := s.context.GenerateKeyPair(
+		session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)},
+		publicTemplate,
+		privateTemplate,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := s.context.GetAttributeValue(session, publicHandle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return createECDSAPubkeyFromAttributes(attrs)
+}
+
+// curveToECParams DER-encodes the named-curve OID CKA_EC_PARAMS expects for
+// curve, the inverse of curveFromECParams.
+func curveToECParams(curve elliptic.Curve) ([]byte, error) {
+	for oid, c := range namedCurveOIDs {
+		if c == curve {
+			parsed, err := stringToOID(oid)
+			if err != nil {
+				return nil, err
+			}
+			return asn1.Marshal(parsed)
+		}
+	}
+	return nil, fmt.Errorf("pkcs11: unsupported named curve %s", curve.Params().Name)
+}
+
+// stringToOID parses a dotted-decimal OID string, such as the keys of
+// namedCurveOIDs, into an asn1.ObjectIdentifier.
+func stringToOID(s string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	component := 0
+	started := false
+	for _, r := range s {
+		if r == '.' {
+			oid = append(oid, component)
+			component = 0
+			started = false
+			continue
+		}
+		if r < '0' || r > '9' {
+			return nil, fmt.Errorf("pkcs11: invalid OID component in %q", s)
+		}
+		component = component*10 + int(r-'0')
+		started = true
+	}
+	if !started {
+		return nil, fmt.Errorf("pkcs11: invalid OID %q", s)
+	}
+	oid = append(oid, component)
+	return oid, nil
+}
+
+// ImportCertificate creates a CKO_CERTIFICATE object on the token holding
+// cert, labeled label and carrying the same CKA_ID as the Store's
+// configured private key, binding the two together.
+func (s *Store) ImportCertificate(cert *x509.Certificate, label string) error {
+	session, err := s.openRWSession()
+	if err != nil {
+		return err
+	}
+	defer s.context.CloseSession(session)
+
+	id, err := s.privateKeyID(session)
+	if err != nil {
+		return err
+	}
+
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE),
+		pkcs11.NewAttribute(pkcs11.CKA_CERTIFICATE_TYPE, pkcs11.CKC_X_509),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		pkcs11.NewAttribute(pkcs11.CKA_SUBJECT, cert.RawSubject),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, cert.Raw),
+	}
+
+	_, err = s.context.CreateObject(session, template)
+	return err
+}
+
+// privateKeyID fetches the CKA_ID of the Store's configured private key, so
+// ImportCertificate can bind a newly imported certificate to it. This looks
+// the object up fresh on session rather than going through the cached
+// privateKeyHandle: session here is a short-lived RW session closed as soon
+// as ImportCertificate returns, and a handle found on it isn't guaranteed
+// valid on the pooled sessions Sign/Decrypt use afterwards.
+func (s *Store) privateKeyID(session pkcs11.SessionHandle) ([]byte, error) {
+	attr, err := s.getAttribute(session, s.config.GetPrivateKeyTemplate(), []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_ID, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attr.Value, nil
+}
+
+// DeleteObject removes the object identified by label and class (one of
+// the pkcs11.CKO_* constants) from the token.
+func (s *Store) DeleteObject(label string, class uint) error {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+
+	session, err := s.openRWSession()
+	if err != nil {
+		return err
+	}
+	defer s.context.CloseSession(session)
+
+	handle, err := s.getObjectHandle(session, template)
+	if err != nil {
+		return err
+	}
+	return s.context.DestroyObject(session, *handle)
+}
+
+// Read fills p with random bytes drawn from the token's C_GenerateRandom,
+// so a Store can be used directly as an io.Reader, e.g. for crypto/rand.
+func (s *Store) Read(p []byte) (int, error) {
+	var random []byte
+	err := s.do(func(session pkcs11.SessionHandle) error {
+		var err error
+		random, err = s.context.GenerateRandom(session, len(p))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, random), nil
+}
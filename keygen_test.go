@@ -0,0 +1,63 @@
+package pksigner
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestStringToOID(t *testing.T) {
+	cases := []struct {
+		in   string
+		want asn1.ObjectIdentifier
+	}{
+		{"1.2.840.10045.3.1.7", asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}},
+		{"1.3.132.0.34", asn1.ObjectIdentifier{1, 3, 132, 0, 34}},
+		{"0", asn1.ObjectIdentifier{0}},
+	}
+	for _, c := range cases {
+		got, err := stringToOID(c.in)
+		if err != nil {
+			t.Fatalf("stringToOID(%q): %s", c.in, err)
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("stringToOID(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestStringToOIDInvalid(t *testing.T) {
+	cases := []string{"", "1.a.2", "1.2.x"}
+	for _, c := range cases {
+		if _, err := stringToOID(c); err == nil {
+			t.Errorf("stringToOID(%q): expected an error", c)
+		}
+	}
+}
+
+func TestCurveToECParams(t *testing.T) {
+	for oidStr, curve := range namedCurveOIDs {
+		der, err := curveToECParams(curve)
+		if err != nil {
+			t.Fatalf("curveToECParams(%s): %s", curve.Params().Name, err)
+		}
+
+		wantOID, err := stringToOID(oidStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantDER, err := asn1.Marshal(wantOID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(der) != string(wantDER) {
+			t.Errorf("curveToECParams(%s) = %x, want %x", curve.Params().Name, der, wantDER)
+		}
+	}
+}
+
+func TestCurveToECParamsUnsupported(t *testing.T) {
+	if _, err := curveToECParams(elliptic.P224()); err == nil {
+		t.Fatal("expected an error for a curve not in namedCurveOIDs")
+	}
+}
@@ -0,0 +1,77 @@
+package pksigner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/miekg/pkcs11"
+)
+
+// PinRetriever supplies the PIN used to log into a token. Store calls
+// GetPin lazily, the first time a PIN is actually needed, so callers don't
+// have to plumb credentials through every Config themselves.
+type PinRetriever interface {
+	// GetPin returns the PIN to log into the token described by
+	// tokenInfo. It's called again, with the same tokenInfo, if the
+	// previous PIN was rejected with CKR_PIN_INCORRECT.
+	GetPin(tokenInfo pkcs11.TokenInfo) (string, error)
+}
+
+// StaticPin is a PinRetriever that always returns the same, fixed PIN.
+type StaticPin string
+
+// GetPin implements PinRetriever.
+func (p StaticPin) GetPin(tokenInfo pkcs11.TokenInfo) (string, error) {
+	return string(p), nil
+}
+
+// EnvPin is a PinRetriever that reads the PIN from the named environment
+// variable.
+type EnvPin string
+
+// GetPin implements PinRetriever.
+func (p EnvPin) GetPin(tokenInfo pkcs11.TokenInfo) (string, error) {
+	pin, ok := os.LookupEnv(string(p))
+	if !ok {
+		return "", fmt.Errorf("pkcs11: environment variable %q is not set", string(p))
+	}
+	return pin, nil
+}
+
+// FilePin is a PinRetriever that reads the PIN from the first line of the
+// named file, such as a pin-source path from a PKCS#11 URI.
+type FilePin string
+
+// GetPin implements PinRetriever.
+func (p FilePin) GetPin(tokenInfo pkcs11.TokenInfo) (string, error) {
+	f, err := os.Open(string(p))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// TerminalPin is a PinRetriever that interactively prompts for the PIN on
+// the controlling terminal, without echoing it back.
+type TerminalPin struct{}
+
+// GetPin implements PinRetriever.
+func (p TerminalPin) GetPin(tokenInfo pkcs11.TokenInfo) (string, error) {
+	fmt.Fprintf(os.Stderr, "Enter PIN for token %q: ", strings.TrimRight(tokenInfo.Label, "\x00"))
+	pin, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(pin), nil
+}
@@ -24,10 +24,12 @@ import (
 	"crypto"
 	"crypto/rsa"
 	"crypto/tls"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"math/big"
 	"strings"
+	"sync"
 
 	"pault.ag/go/piv"
 
@@ -65,42 +67,90 @@ type Config struct {
 
 	// Name of the token, if there are more than exactly one.
 	TokenLabel string
+
+	// Manufacturer, if set, further constrains slot selection to tokens
+	// reporting this CK_TOKEN_INFO.manufacturerID. Useful alongside, or
+	// instead of, TokenLabel when labels collide across tokens.
+	Manufacturer string
+
+	// Serial, if set, further constrains slot selection to tokens
+	// reporting this CK_TOKEN_INFO.serialNumber. This is the most
+	// unambiguous way to target a specific token.
+	Serial string
+
+	// ID, if set, is matched against CKA_ID on both the certificate and
+	// private key templates, to disambiguate multiple key pairs sharing
+	// a label.
+	ID []byte
+
+	// PinRetriever supplies the PIN used to log into the token, on
+	// demand, the first time a PIN is actually required. If nil, Sign
+	// and Decrypt will fail with an error instead of logging in
+	// automatically, and callers must call Store.Login themselves.
+	PinRetriever PinRetriever
+
+	// MaxSessions is the number of PKCS#11 sessions New opens and keeps
+	// in its pool for concurrent Sign/Decrypt/LoadCertificate calls. If
+	// zero or negative, a single session is used, matching the old
+	// single-session behavior.
+	MaxSessions int
 }
 
 // GetCertificateTemplate creates a pkcs11.Attribute array containing
 // constraints that should uniquely identify the PKCS#11 Certificate we're
 // interested in
 func (c Config) GetCertificateTemplate() []*pkcs11.Attribute {
-	return []*pkcs11.Attribute{
-		pkcs11.NewAttribute(pkcs11.CKA_LABEL, c.CertificateLabel),
-		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE),
+	tmpl := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE)}
+	if c.CertificateLabel != "" {
+		tmpl = append(tmpl, pkcs11.NewAttribute(pkcs11.CKA_LABEL, c.CertificateLabel))
+	}
+	if c.ID != nil {
+		tmpl = append(tmpl, pkcs11.NewAttribute(pkcs11.CKA_ID, c.ID))
 	}
+	return tmpl
 }
 
 // GetPrivateKeyTemplate returns a pkcs11.Attribute array containing
 // constraints that should uniquely identify the PKCS#11 private key we're
 // interested in
 func (c Config) GetPrivateKeyTemplate() []*pkcs11.Attribute {
-	return []*pkcs11.Attribute{
-		pkcs11.NewAttribute(pkcs11.CKA_LABEL, c.PrivateKeyLabel),
-		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+	tmpl := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY)}
+	if c.PrivateKeyLabel != "" {
+		tmpl = append(tmpl, pkcs11.NewAttribute(pkcs11.CKA_LABEL, c.PrivateKeyLabel))
+	}
+	if c.ID != nil {
+		tmpl = append(tmpl, pkcs11.NewAttribute(pkcs11.CKA_ID, c.ID))
 	}
+	return tmpl
 }
 
 // Figure out if the TokenInfo we're looking for matches the TokenInfo
 // we've got in front of us. This is used to filter out tokens during
-// the setup phase.
+// the setup phase. At least one of TokenLabel, Manufacturer or Serial
+// must be set, and every one that is set must match.
 func (c Config) slotMatchesCriteria(tokenInfo pkcs11.TokenInfo) bool {
-	return strings.TrimRight(tokenInfo.Label, "\x00") == c.TokenLabel
+	if c.TokenLabel == "" && c.Manufacturer == "" && c.Serial == "" {
+		return false
+	}
+	if c.TokenLabel != "" && strings.TrimRight(tokenInfo.Label, "\x00") != c.TokenLabel {
+		return false
+	}
+	if c.Manufacturer != "" && strings.TrimRight(tokenInfo.ManufacturerID, "\x00") != c.Manufacturer {
+		return false
+	}
+	if c.Serial != "" && strings.TrimRight(tokenInfo.SerialNumber, "\x00") != c.Serial {
+		return false
+	}
+	return true
 }
 
 // SelectSlot takes a pkcs11.Ctx and a list of slots, figures out which slot is
 // the slot we're interested in, returning an error if there's nothing we
 // should be using.
 func (c Config) SelectSlot(context *pkcs11.Ctx, slots []uint) (uint, error) {
-	/* If there's no label matching, and there's only one slot, return
-	 * that slot */
-	if c.TokenLabel == "" {
+	/* If there's no selection criteria at all, and there's only one slot,
+	 * return that slot */
+	if c.TokenLabel == "" && c.Manufacturer == "" && c.Serial == "" {
 		if len(slots) == 1 {
 			return slots[0], nil
 		}
@@ -122,17 +172,33 @@ func (c Config) SelectSlot(context *pkcs11.Ctx, slots []uint) (uint, error) {
 // Close logs out of the Token, and closes any open sessions we might
 // have open. This method ought to be defer'd after creating a new
 // hsm.Store.
-func (s Store) Close() error {
-	if s.loggedIn {
-		if s.context != nil && s.session != nil {
-			if err := s.context.Logout(*s.session); err != nil {
+func (s *Store) Close() error {
+	s.stateMu.Lock()
+	for i := range s.pin {
+		s.pin[i] = 0
+	}
+	s.pin = nil
+	loggedIn := s.loggedIn
+	s.loggedIn = false
+	s.stateMu.Unlock()
+
+	if loggedIn {
+		if session, err := s.checkoutSession(); err == nil {
+			if err := s.context.Logout(session); err != nil {
+				s.releaseSession(session)
 				return err
 			}
+			s.releaseSession(session)
 		}
 	}
 
-	if s.session != nil {
-		return s.context.CloseSession(*s.session)
+	if s.sessions != nil {
+		close(s.sessions)
+		for session := range s.sessions {
+			if err := s.context.CloseSession(session); err != nil {
+				return err
+			}
+		}
 	}
 
 	if s.context != nil {
@@ -165,14 +231,20 @@ func New(config Config) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
+	cStore.slot = slot
 
-	// XXX: only get rw if it's needed
-	var sessionBitmask uint = pkcs11.CKF_SERIAL_SESSION // | pkcs11.CKF_RW_SESSION
-	session, err := cStore.context.OpenSession(slot, sessionBitmask)
-	if err != nil {
-		return nil, err
+	maxSessions := config.MaxSessions
+	if maxSessions <= 0 {
+		maxSessions = 1
+	}
+	cStore.sessions = make(chan pkcs11.SessionHandle, maxSessions)
+	for i := 0; i < maxSessions; i++ {
+		session, err := cStore.openSession()
+		if err != nil {
+			return nil, err
+		}
+		cStore.sessions <- session
 	}
-	cStore.session = &session
 
 	cert, err := cStore.LoadCertificate()
 	if err != nil {
@@ -185,37 +257,125 @@ func New(config Config) (*Store, error) {
 	return &cStore, err
 }
 
-// Login unlocks a smartcard with the provided PIN.
-func (s Store) Login(pin string) error {
-	err := s.context.Login(*s.session, pkcs11.CKU_USER, pin)
+// openSession opens a single RO session against the Store's slot. It's the
+// building block both New and the pool's reconnection logic use.
+func (s *Store) openSession() (pkcs11.SessionHandle, error) {
+	return s.context.OpenSession(s.slot, pkcs11.CKF_SERIAL_SESSION)
+}
+
+// openRWSession opens a single read-write session against the Store's slot,
+// for the provisioning operations (key generation, certificate import,
+// object deletion) that need one. Unlike the pooled RO sessions, these are
+// opened on demand and closed by the caller when done, since they're rare
+// compared to the hot Sign/Decrypt path.
+func (s *Store) openRWSession() (pkcs11.SessionHandle, error) {
+	return s.context.OpenSession(s.slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+}
+
+// Login unlocks a smartcard with the provided PIN. The login applies to
+// the whole token, not just the session used to perform it, so every
+// pooled session sees it.
+func (s *Store) Login(pin string) error {
+	session, err := s.checkoutSession()
+	if err != nil {
+		return err
+	}
+	defer s.releaseSession(session)
+
+	err = s.context.Login(session, pkcs11.CKU_USER, pin)
 	if err == nil {
-		s.loggedIn = true
+		s.setLoggedIn(true, []byte(pin))
 	}
 	return err
 }
 
+// setLoggedIn atomically updates the cached login state and PIN, which are
+// read from Sign/Decrypt/reauthIfRequired and the pool's reopenSession.
+func (s *Store) setLoggedIn(loggedIn bool, pin []byte) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.loggedIn = loggedIn
+	s.pin = pin
+}
+
+// isLoggedIn reports the cached login state.
+func (s *Store) isLoggedIn() bool {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.loggedIn
+}
+
+// currentPin returns the cached PIN, used to re-login a reopened session or
+// satisfy a CKA_ALWAYS_AUTHENTICATE challenge without re-prompting.
+func (s *Store) currentPin() []byte {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.pin
+}
+
+// autoLogin lazily logs into the token using s.config.PinRetriever, the
+// first time a PIN is actually needed. It re-prompts on CKR_PIN_INCORRECT,
+// giving up as soon as the retriever errors or the token locks.
+func (s *Store) autoLogin() error {
+	if s.isLoggedIn() {
+		return nil
+	}
+	if s.config.PinRetriever == nil {
+		return fmt.Errorf("pkcs11: session is not logged in and no PinRetriever is configured")
+	}
+
+	tokenInfo, err := s.context.GetTokenInfo(s.slot)
+	if err != nil {
+		return err
+	}
+
+	for {
+		pin, err := s.config.PinRetriever.GetPin(tokenInfo)
+		if err != nil {
+			return err
+		}
+
+		err = s.Login(pin)
+		if err == nil {
+			return nil
+		}
+		if rv, ok := err.(pkcs11.Error); ok && uint(rv) == pkcs11.CKR_PIN_INCORRECT {
+			continue
+		}
+		return err
+	}
+}
+
 // Store is the internal hsm.Store encaupsulating state. This implements the
 // store.Store interface, as well as crypto.Signer, and crypto.Decryptor.
 type Store struct {
 	config *Config
 
-	session *pkcs11.SessionHandle
-	context *pkcs11.Ctx
+	slot     uint
+	sessions chan pkcs11.SessionHandle
+	context  *pkcs11.Ctx
 
-	loggedIn bool
+	// stateMu guards loggedIn, pin and cachedPrivateKeyHandle, all of which
+	// are read and written from Sign/Decrypt/autoLogin/reauthIfRequired as
+	// well as the pool's reopenSession, any of which can run concurrently
+	// once MaxSessions lets multiple goroutines sign/decrypt at once.
+	stateMu                sync.Mutex
+	loggedIn               bool
+	pin                    []byte
+	cachedPrivateKeyHandle *pkcs11.ObjectHandle
 
 	PublicKey   crypto.PublicKey
 	Certificate *piv.Certificate
 }
 
 // Get the object handles that match the set of pkcs11.Attribute critiera
-func (s Store) getObjectHandles(template []*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
-	if err := s.context.FindObjectsInit(*s.session, template); err != nil {
+func (s *Store) getObjectHandles(session pkcs11.SessionHandle, template []*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
+	if err := s.context.FindObjectsInit(session, template); err != nil {
 		return nil, err
 	}
 	objects := []pkcs11.ObjectHandle{}
 	for {
-		obj, more, err := s.context.FindObjects(*s.session, 8)
+		obj, more, err := s.context.FindObjects(session, 8)
 		if err != nil {
 			return nil, err
 		}
@@ -225,7 +385,7 @@ func (s Store) getObjectHandles(template []*pkcs11.Attribute) ([]pkcs11.ObjectHa
 			break
 		}
 	}
-	if err := s.context.FindObjectsFinal(*s.session); err != nil {
+	if err := s.context.FindObjectsFinal(session); err != nil {
 		return nil, err
 	}
 	return objects, nil
@@ -234,8 +394,8 @@ func (s Store) getObjectHandles(template []*pkcs11.Attribute) ([]pkcs11.ObjectHa
 // Get the one and only one object that match the set of pkcs11.Attribute
 // criteria. If multiple handles are returned, throw an error out,
 // and if no objects are returned, throw an error.
-func (s Store) getObjectHandle(template []*pkcs11.Attribute) (*pkcs11.ObjectHandle, error) {
-	candidates, err := s.getObjectHandles(template)
+func (s *Store) getObjectHandle(session pkcs11.SessionHandle, template []*pkcs11.Attribute) (*pkcs11.ObjectHandle, error) {
+	candidates, err := s.getObjectHandles(session, template)
 	if err != nil {
 		return nil, err
 	}
@@ -251,19 +411,19 @@ func (s Store) getObjectHandle(template []*pkcs11.Attribute) (*pkcs11.ObjectHand
 // Find the object defined by `locate`, and return the attributes returned by
 // `attributes`. This is useful for looking up an object that we know is
 // unique, and returning the attributes we're interested in.
-func (s Store) getAttributes(locate, attributes []*pkcs11.Attribute) ([]*pkcs11.Attribute, error) {
-	objectHandle, err := s.getObjectHandle(locate)
+func (s *Store) getAttributes(session pkcs11.SessionHandle, locate, attributes []*pkcs11.Attribute) ([]*pkcs11.Attribute, error) {
+	objectHandle, err := s.getObjectHandle(session, locate)
 	if err != nil {
 		return nil, err
 	}
-	return s.context.GetAttributeValue(*s.session, *objectHandle, attributes)
+	return s.context.GetAttributeValue(session, *objectHandle, attributes)
 }
 
 // Find the object defined by `locate`, and return the attribute we're interested
 // in, defined by `attribuets`. If multiple handles or multiple attribuets are
 // returned, an error will be returned.
-func (s Store) getAttribute(locate, attributes []*pkcs11.Attribute) (*pkcs11.Attribute, error) {
-	attr, err := s.getAttributes(locate, attributes)
+func (s *Store) getAttribute(session pkcs11.SessionHandle, locate, attributes []*pkcs11.Attribute) (*pkcs11.Attribute, error) {
+	attr, err := s.getAttributes(session, locate, attributes)
 	if err != nil {
 		return nil, err
 	}
@@ -275,22 +435,75 @@ func (s Store) getAttribute(locate, attributes []*pkcs11.Attribute) (*pkcs11.Att
 	return attr[0], nil
 }
 
+// privateKeyHandle returns the ObjectHandle of the configured private key,
+// looking it up via FindObjects only the first time it's needed. Hot
+// signing/decryption paths skip FindObjects entirely afterwards.
+func (s *Store) privateKeyHandle(session pkcs11.SessionHandle) (pkcs11.ObjectHandle, error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.cachedPrivateKeyHandle != nil {
+		return *s.cachedPrivateKeyHandle, nil
+	}
+
+	handle, err := s.getObjectHandle(session, s.config.GetPrivateKeyTemplate())
+	if err != nil {
+		return 0, err
+	}
+	s.cachedPrivateKeyHandle = handle
+	return *handle, nil
+}
+
 // LoadCertificate queries the underlying HSM Store for the x509 Certificate
 // we're interested in, and returns a Go x509.Certificate.
-func (s Store) LoadCertificate() (*piv.Certificate, error) {
-	certAttribute, err := s.getAttribute(
-		s.config.GetCertificateTemplate(),
-		[]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil)},
-	)
-	if err != nil {
-		return nil, err
+func (s *Store) LoadCertificate() (*piv.Certificate, error) {
+	var cert *piv.Certificate
+	err := s.do(func(session pkcs11.SessionHandle) error {
+		certAttribute, err := s.getAttribute(
+			session,
+			s.config.GetCertificateTemplate(),
+			[]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil)},
+		)
+		if err != nil {
+			return err
+		}
+
+		parsed, err := piv.ParseCertificate(certAttribute.Value)
+		if err != nil {
+			return err
+		}
+		cert = parsed
+		return nil
+	})
+	return cert, err
+}
+
+// Create a Go crypto.PublicKey from the PKCS#11 attribute array we've fetched
+// from the underlying store, dispatching on the CKA_KEY_TYPE of the object
+// the attributes came from.
+func createPubkeyFromAttributes(keyType uint, attributes []*pkcs11.Attribute) (crypto.PublicKey, error) {
+	switch keyType {
+	case pkcs11.CKK_RSA:
+		return createRSAPubkeyFromAttributes(attributes), nil
+	case pkcs11.CKK_EC:
+		// PKCS#11 v2.40 tokens predate CKK_EC_EDWARDS, and mark an
+		// Ed25519 key by reporting plain CKK_EC with the id-Ed25519 OID
+		// in CKA_EC_PARAMS instead.
+		if ecParamsIndicateEd25519(attributes) {
+			return createEd25519PubkeyFromAttributes(attributes)
+		}
+		return createECDSAPubkeyFromAttributes(attributes)
+	case ckkECEdwards:
+		return createEd25519PubkeyFromAttributes(attributes)
+	default:
+		return nil, fmt.Errorf("pkcs11: unsupported CKA_KEY_TYPE %d", keyType)
 	}
-	return piv.ParseCertificate(certAttribute.Value)
 }
 
-// Create a Go rsa.PublicKey from the PKCS#11 attribute array we've fetched from
-// the underlying store.
-func createPubkeyFromAttributes(attributes []*pkcs11.Attribute) (crypto.PublicKey, error) {
+// createRSAPubkeyFromAttributes builds a Go rsa.PublicKey from the
+// CKA_MODULUS and CKA_PUBLIC_EXPONENT attributes of an RSA public or
+// private key object.
+func createRSAPubkeyFromAttributes(attributes []*pkcs11.Attribute) *rsa.PublicKey {
 	key := rsa.PublicKey{
 		N: big.NewInt(0),
 	}
@@ -311,7 +524,36 @@ func createPubkeyFromAttributes(attributes []*pkcs11.Attribute) (crypto.PublicKe
 			key.E = int(exp.Int64())
 		}
 	}
-	return &key, nil
+	return &key
+}
+
+// keyType fetches the CKA_KEY_TYPE of an already-located key object, so
+// Sign and friends can dispatch to the right PKCS#11 mechanism.
+func (s *Store) keyType(session pkcs11.SessionHandle, handle pkcs11.ObjectHandle) (uint, error) {
+	attrs, err := s.context.GetAttributeValue(
+		session, handle,
+		[]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil)},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if len(attrs) != 1 {
+		return 0, fmt.Errorf("pkcs11: couldn't determine CKA_KEY_TYPE")
+	}
+	return bytesToULong(attrs[0].Value), nil
+}
+
+// bytesToULong decodes the native-endian CK_ULONG PKCS#11 hands back as
+// attribute bytes.
+func bytesToULong(value []byte) uint {
+	switch len(value) {
+	case 4:
+		return uint(binary.LittleEndian.Uint32(value))
+	case 8:
+		return uint(binary.LittleEndian.Uint64(value))
+	default:
+		return 0
+	}
 }
 
 // Public returns the cached PublicKey, because the interface we're
@@ -321,23 +563,81 @@ func createPubkeyFromAttributes(attributes []*pkcs11.Attribute) (crypto.PublicKe
 // This has a downside of not being able to read the PublicKey if it changes
 // during our session (womp), but maybe that's not a problem? Who can know.
 // If that's a problem you hit, maybe we should do something smarter here.
-func (s Store) Public() crypto.PublicKey {
+func (s *Store) Public() crypto.PublicKey {
 	return s.PublicKey
 }
 
 // Sign implements crypto.Signer. This will have the HSM sign the hash given,
 // ignoring the entropy source `rand` on chip, and return the signature blob.
-func (s Store) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+// The PKCS#11 mechanism used depends on the CKA_KEY_TYPE of the located
+// private key: RSA, ECDSA and Ed25519 keys are all supported. If the
+// session isn't logged in yet, or the key requires CKA_ALWAYS_AUTHENTICATE,
+// Login is triggered transparently via Config.PinRetriever.
+func (s *Store) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := s.autoLogin(); err != nil {
+		return nil, err
+	}
+
+	sig, err := s.sign(digest, opts)
+	if isNotLoggedIn(err) {
+		s.setLoggedIn(false, nil)
+		if loginErr := s.autoLogin(); loginErr != nil {
+			return nil, loginErr
+		}
+		sig, err = s.sign(digest, opts)
+	}
+	return sig, err
+}
+
+func (s *Store) sign(digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var sig []byte
+	err := s.do(func(session pkcs11.SessionHandle) error {
+		privateKey, err := s.privateKeyHandle(session)
+		if err != nil {
+			return err
+		}
+
+		if err := s.reauthIfRequired(session, privateKey); err != nil {
+			return err
+		}
+
+		keyType, err := s.keyType(session, privateKey)
+		if err != nil {
+			return err
+		}
+
+		switch keyType {
+		case pkcs11.CKK_EC:
+			// See the matching comment in createPubkeyFromAttributes:
+			// PKCS#11 v2.40 tokens report Ed25519 keys as plain CKK_EC.
+			if s.isEd25519Key(session, privateKey) {
+				sig, err = s.signEdDSA(session, privateKey, digest)
+			} else {
+				sig, err = s.signECDSA(session, privateKey, digest)
+			}
+		case ckkECEdwards:
+			sig, err = s.signEdDSA(session, privateKey, digest)
+		default:
+			sig, err = s.signRSA(session, privateKey, digest, opts)
+		}
+		return err
+	})
+	return sig, err
+}
+
+// signRSA has the HSM sign a digest, dispatching to CKM_RSA_PKCS_PSS when
+// opts asks for PSS, and otherwise falling back to CKM_RSA_PKCS with the
+// digest prefixed with the DigestInfo header the hash algorithm requires.
+func (s *Store) signRSA(session pkcs11.SessionHandle, privateKey pkcs11.ObjectHandle, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+		return s.signRSAPSS(session, privateKey, digest, pssOpts)
+	}
+
 	hash := opts.HashFunc()
 	if len(digest) != hash.Size() {
 		return nil, fmt.Errorf("pkcs11: Digest length doesn't match passed crypto algorithm")
 	}
 
-	privateKey, err := s.getObjectHandle(s.config.GetPrivateKeyTemplate())
-	if err != nil {
-		return nil, err
-	}
-
 	hashOID, ok := hashOIDs[hash]
 	if !ok {
 		return nil, fmt.Errorf("pkcs11: Unsupported algorithm")
@@ -345,42 +645,114 @@ func (s Store) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]by
 	digest = append(hashOID, digest...)
 
 	if err := s.context.SignInit(
-		*s.session,
+		session,
 		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)},
-		*privateKey,
+		privateKey,
 	); err != nil {
 		return nil, err
 	}
-	return s.context.Sign(*s.session, digest)
+	return s.context.Sign(session, digest)
 }
 
 // Decrypt implements crypto.Decryptor. This will have the HSM Decrypt the
 // encrypted data given, ignoring `rand`, and using on chip entropy sources.
-// This will return the data in cleartext.
-func (s Store) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
-	privateKey, err := s.getObjectHandle(s.config.GetPrivateKeyTemplate())
-	if err != nil {
+// This will return the data in cleartext. Passing *rsa.OAEPOptions in opts
+// switches the mechanism to CKM_RSA_PKCS_OAEP; otherwise the legacy
+// CKM_RSA_PKCS (PKCS#1 v1.5) mechanism is used. If the session isn't
+// logged in yet, or the key requires CKA_ALWAYS_AUTHENTICATE, Login is
+// triggered transparently via Config.PinRetriever.
+func (s *Store) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if err := s.autoLogin(); err != nil {
 		return nil, err
 	}
 
-	if err := s.context.DecryptInit(
-		*s.session,
-		[]*pkcs11.Mechanism{pkcs11.NewMechanism(
-			pkcs11.CKM_RSA_PKCS,
-			nil,
-		)},
-		*privateKey,
-	); err != nil {
-		return nil, err
+	cleartext, err := s.decrypt(msg, opts)
+	if isNotLoggedIn(err) {
+		s.setLoggedIn(false, nil)
+		if loginErr := s.autoLogin(); loginErr != nil {
+			return nil, loginErr
+		}
+		cleartext, err = s.decrypt(msg, opts)
 	}
+	return cleartext, err
+}
+
+func (s *Store) decrypt(msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	var cleartext []byte
+	err := s.do(func(session pkcs11.SessionHandle) error {
+		privateKey, err := s.privateKeyHandle(session)
+		if err != nil {
+			return err
+		}
+
+		if err := s.reauthIfRequired(session, privateKey); err != nil {
+			return err
+		}
+
+		if oaepOpts, ok := opts.(*rsa.OAEPOptions); ok {
+			cleartext, err = s.decryptOAEP(session, privateKey, msg, oaepOpts)
+			return err
+		}
+
+		if err := s.context.DecryptInit(
+			session,
+			[]*pkcs11.Mechanism{pkcs11.NewMechanism(
+				pkcs11.CKM_RSA_PKCS,
+				nil,
+			)},
+			privateKey,
+		); err != nil {
+			return err
+		}
+
+		cleartext, err = s.context.Decrypt(session, msg)
+		return err
+	})
+	return cleartext, err
+}
+
+// reauthIfRequired performs a CKU_CONTEXT_SPECIFIC login immediately
+// before a private key operation, as PIV "PIN Always" keys require, if
+// the key's CKA_ALWAYS_AUTHENTICATE attribute is set.
+func (s *Store) reauthIfRequired(session pkcs11.SessionHandle, privateKey pkcs11.ObjectHandle) error {
+	attrs, err := s.context.GetAttributeValue(
+		session, privateKey,
+		[]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_ALWAYS_AUTHENTICATE, nil)},
+	)
+	if err != nil || len(attrs) != 1 || len(attrs[0].Value) != 1 || attrs[0].Value[0] == 0 {
+		// Tokens that don't expose this attribute aren't PIV "PIN
+		// Always" keys, so there's nothing extra to do.
+		return nil
+	}
+
+	pin := string(s.currentPin())
+	if pin == "" {
+		if s.config.PinRetriever == nil {
+			return fmt.Errorf("pkcs11: key requires CKA_ALWAYS_AUTHENTICATE and no PinRetriever is configured")
+		}
+		tokenInfo, err := s.context.GetTokenInfo(s.slot)
+		if err != nil {
+			return err
+		}
+		pin, err = s.config.PinRetriever.GetPin(tokenInfo)
+		if err != nil {
+			return err
+		}
+	}
+	return s.context.Login(session, pkcs11.CKU_CONTEXT_SPECIFIC, pin)
+}
 
-	return s.context.Decrypt(*s.session, msg)
+// isNotLoggedIn reports whether err is the PKCS#11 CKR_USER_NOT_LOGGED_IN
+// error, which Sign and Decrypt treat as a cue to log in and retry once.
+func isNotLoggedIn(err error) bool {
+	rv, ok := err.(pkcs11.Error)
+	return ok && uint(rv) == pkcs11.CKR_USER_NOT_LOGGED_IN
 }
 
 // TLSCertificate queries the underlying HSM Store for the x509 Certificate
 // we're interested in, and returns a tls.Certificate containing both the
 // public and private portions.
-func (s Store) TLSCertificate() (*tls.Certificate, error) {
+func (s *Store) TLSCertificate() (*tls.Certificate, error) {
 	cert, err := s.LoadCertificate()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,93 @@
+package pksigner
+
+import (
+	"fmt"
+
+	"github.com/miekg/pkcs11"
+)
+
+// checkoutSession takes a session out of the pool, blocking until one is
+// available. Callers must return it with releaseSession.
+func (s *Store) checkoutSession() (pkcs11.SessionHandle, error) {
+	session, ok := <-s.sessions
+	if !ok {
+		return 0, fmt.Errorf("pkcs11: session pool is closed")
+	}
+	return session, nil
+}
+
+// releaseSession returns a session checked out with checkoutSession back to
+// the pool.
+func (s *Store) releaseSession(session pkcs11.SessionHandle) {
+	s.sessions <- session
+}
+
+// do checks out a session, runs fn as an atomic unit against it, and
+// returns it to the pool. If fn fails because the session died out from
+// under us (the token was removed and reinserted, say), do transparently
+// reopens a session and retries fn once before giving up.
+func (s *Store) do(fn func(session pkcs11.SessionHandle) error) error {
+	session, err := s.checkoutSession()
+	if err != nil {
+		return err
+	}
+
+	err = fn(session)
+	if isSessionDead(err) {
+		newSession, reopenErr := s.reopenSession(session)
+		if reopenErr != nil {
+			// reopenSession already closed the dead handle, so there's
+			// nothing good to hand back to the pool; returning it would
+			// let some later, unrelated checkoutSession (Login included)
+			// pull out a SessionHandle that's permanently invalid. Drop
+			// it and let the pool run one slot short rather than poison
+			// it.
+			return err
+		}
+		session = newSession
+		err = fn(session)
+	}
+
+	s.releaseSession(session)
+	return err
+}
+
+// reopenSession replaces a session that's gone bad with a freshly opened
+// one, re-logging in if the Store was logged in, and invalidating the
+// cached private-key handle, which belonged to the dead session.
+func (s *Store) reopenSession(dead pkcs11.SessionHandle) (pkcs11.SessionHandle, error) {
+	s.context.CloseSession(dead) // best-effort; the session is already gone
+
+	session, err := s.openSession()
+	if err != nil {
+		return 0, err
+	}
+
+	if s.isLoggedIn() {
+		if err := s.context.Login(session, pkcs11.CKU_USER, string(s.currentPin())); err != nil {
+			s.context.CloseSession(session)
+			return 0, err
+		}
+	}
+
+	s.stateMu.Lock()
+	s.cachedPrivateKeyHandle = nil
+	s.stateMu.Unlock()
+
+	return session, nil
+}
+
+// isSessionDead reports whether err indicates the session itself is no
+// longer usable (as opposed to, say, a bad PIN), and should be replaced
+// rather than returned to the pool.
+func isSessionDead(err error) bool {
+	rv, ok := err.(pkcs11.Error)
+	if !ok {
+		return false
+	}
+	switch uint(rv) {
+	case pkcs11.CKR_SESSION_HANDLE_INVALID, pkcs11.CKR_DEVICE_ERROR:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package pksigner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+)
+
+func TestIsSessionDead(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"session handle invalid", pkcs11.Error(pkcs11.CKR_SESSION_HANDLE_INVALID), true},
+		{"device error", pkcs11.Error(pkcs11.CKR_DEVICE_ERROR), true},
+		{"pin incorrect", pkcs11.Error(pkcs11.CKR_PIN_INCORRECT), false},
+		{"non-pkcs11 error", errors.New("boom"), false},
+		{"nil", nil, false},
+	}
+	for _, c := range cases {
+		if got := isSessionDead(c.err); got != c.want {
+			t.Errorf("%s: isSessionDead() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// TestDoReleasesSessionOnSuccess and TestDoReleasesSessionOnNonFatalError
+// cover the two do() paths that never touch real PKCS#11 hardware: the
+// reconnect path (do -> reopenSession -> Ctx.OpenSession/Login) requires an
+// actual token and isn't exercised here, matching every other HSM-bound
+// path in this package.
+func TestDoReleasesSessionOnSuccess(t *testing.T) {
+	s := &Store{sessions: make(chan pkcs11.SessionHandle, 1)}
+	s.sessions <- pkcs11.SessionHandle(7)
+
+	var got pkcs11.SessionHandle
+	err := s.do(func(session pkcs11.SessionHandle) error {
+		got = session
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 7 {
+		t.Fatalf("fn was called with session %d, want 7", got)
+	}
+
+	select {
+	case session := <-s.sessions:
+		if session != 7 {
+			t.Fatalf("pool returned session %d, want 7", session)
+		}
+	default:
+		t.Fatal("session was not returned to the pool")
+	}
+}
+
+func TestDoReleasesSessionOnNonFatalError(t *testing.T) {
+	s := &Store{sessions: make(chan pkcs11.SessionHandle, 1)}
+	s.sessions <- pkcs11.SessionHandle(3)
+
+	wantErr := pkcs11.Error(pkcs11.CKR_PIN_INCORRECT)
+	err := s.do(func(session pkcs11.SessionHandle) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("do() = %v, want %v", err, wantErr)
+	}
+
+	select {
+	case session := <-s.sessions:
+		if session != 3 {
+			t.Fatalf("pool returned session %d, want 3", session)
+		}
+	default:
+		t.Fatal("session was not returned to the pool after a non-fatal error")
+	}
+}
+
+// BenchmarkSessionPoolConcurrent exercises checkoutSession/releaseSession
+// under concurrent load, the contention Sign/Decrypt put on the pool once
+// MaxSessions lets multiple goroutines run at once. It doesn't touch real
+// PKCS#11 hardware, since none is available in CI; it benchmarks the pool
+// mechanics in isolation.
+func BenchmarkSessionPoolConcurrent(b *testing.B) {
+	const poolSize = 4
+	s := &Store{sessions: make(chan pkcs11.SessionHandle, poolSize)}
+	for i := 0; i < poolSize; i++ {
+		s.sessions <- pkcs11.SessionHandle(i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			session, err := s.checkoutSession()
+			if err != nil {
+				b.Fatal(err)
+			}
+			s.releaseSession(session)
+		}
+	})
+}
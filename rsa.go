@@ -0,0 +1,145 @@
+package pksigner
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+
+	"github.com/miekg/pkcs11"
+)
+
+// hashMechanisms maps a crypto.Hash to the PKCS#11 mechanism used to
+// identify it inside CK_RSA_PKCS_PSS_PARAMS / CK_RSA_PKCS_OAEP_PARAMS.
+var hashMechanisms = map[crypto.Hash]uint{
+	crypto.SHA1:   pkcs11.CKM_SHA_1,
+	crypto.SHA224: pkcs11.CKM_SHA224,
+	crypto.SHA256: pkcs11.CKM_SHA256,
+	crypto.SHA384: pkcs11.CKM_SHA384,
+	crypto.SHA512: pkcs11.CKM_SHA512,
+}
+
+// mgfMechanisms maps a crypto.Hash to the MGF1 variant that uses it, for
+// the same two parameter structures.
+var mgfMechanisms = map[crypto.Hash]uint{
+	crypto.SHA1:   pkcs11.CKG_MGF1_SHA1,
+	crypto.SHA224: pkcs11.CKG_MGF1_SHA224,
+	crypto.SHA256: pkcs11.CKG_MGF1_SHA256,
+	crypto.SHA384: pkcs11.CKG_MGF1_SHA384,
+	crypto.SHA512: pkcs11.CKG_MGF1_SHA512,
+}
+
+// signRSAPSS has the HSM sign a raw digest with CKM_RSA_PKCS_PSS, built
+// from the hash, MGF1 variant, and salt length described by opts.
+func (s *Store) signRSAPSS(session pkcs11.SessionHandle, privateKey pkcs11.ObjectHandle, digest []byte, opts *rsa.PSSOptions) ([]byte, error) {
+	hash := opts.HashFunc()
+	hashMech, ok := hashMechanisms[hash]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: Unsupported PSS hash algorithm")
+	}
+	mgfMech, ok := mgfMechanisms[hash]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: Unsupported PSS MGF1 hash algorithm")
+	}
+
+	saltLength, err := s.pssSaltLength(session, privateKey, hash, opts.SaltLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.context.SignInit(
+		session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(
+			pkcs11.CKM_RSA_PKCS_PSS,
+			pkcs11.NewPSSParams(hashMech, mgfMech, saltLength),
+		)},
+		privateKey,
+	); err != nil {
+		return nil, err
+	}
+	return s.context.Sign(session, digest)
+}
+
+// pssSaltLength resolves an rsa.PSSOptions.SaltLength into the concrete
+// salt length CK_RSA_PKCS_PSS_PARAMS wants, honoring PSSSaltLengthEqualsHash
+// and PSSSaltLengthAuto (the modulus-derived maximum).
+func (s *Store) pssSaltLength(session pkcs11.SessionHandle, privateKey pkcs11.ObjectHandle, hash crypto.Hash, requested int) (uint, error) {
+	if requested == rsa.PSSSaltLengthAuto {
+		modBits, err := s.modulusBitLen(session, privateKey)
+		if err != nil {
+			return 0, err
+		}
+		return saltLengthForModulus(modBits, hash)
+	}
+	return saltLength(hash, requested)
+}
+
+// saltLengthForModulus computes the PSSSaltLengthAuto salt length (the
+// maximum that fits alongside a hash of the given size in an EMSA-PSS
+// encoding) for an RSA modulus modBits bits wide.
+func saltLengthForModulus(modBits int, hash crypto.Hash) (uint, error) {
+	emLen := (modBits - 1 + 7) / 8
+	maxSaltLength := emLen - hash.Size() - 2
+	if maxSaltLength < 0 {
+		return 0, fmt.Errorf("pkcs11: RSA modulus too small for PSS with this hash")
+	}
+	return uint(maxSaltLength), nil
+}
+
+// saltLength resolves the non-Auto rsa.PSSOptions.SaltLength cases:
+// PSSSaltLengthEqualsHash and explicit non-negative lengths.
+func saltLength(hash crypto.Hash, requested int) (uint, error) {
+	switch {
+	case requested == rsa.PSSSaltLengthEqualsHash:
+		return uint(hash.Size()), nil
+	case requested < 0:
+		return 0, fmt.Errorf("pkcs11: unsupported PSS salt length %d", requested)
+	default:
+		return uint(requested), nil
+	}
+}
+
+// modulusBitLen fetches CKA_MODULUS off of a (possibly private) key handle
+// and returns its size in bits.
+func (s *Store) modulusBitLen(session pkcs11.SessionHandle, key pkcs11.ObjectHandle) (int, error) {
+	attrs, err := s.context.GetAttributeValue(
+		session, key,
+		[]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil)},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if len(attrs) != 1 || len(attrs[0].Value) == 0 {
+		return 0, fmt.Errorf("pkcs11: couldn't determine CKA_MODULUS")
+	}
+	return new(big.Int).SetBytes(attrs[0].Value).BitLen(), nil
+}
+
+// decryptOAEP has the HSM decrypt a ciphertext with CKM_RSA_PKCS_OAEP,
+// built from the hash, MGF1 variant, and label described by opts.
+func (s *Store) decryptOAEP(session pkcs11.SessionHandle, privateKey pkcs11.ObjectHandle, msg []byte, opts *rsa.OAEPOptions) ([]byte, error) {
+	hash := opts.Hash
+	if hash == 0 {
+		hash = crypto.SHA1
+	}
+	hashMech, ok := hashMechanisms[hash]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: Unsupported OAEP hash algorithm")
+	}
+	mgfMech, ok := mgfMechanisms[hash]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: Unsupported OAEP MGF1 hash algorithm")
+	}
+
+	if err := s.context.DecryptInit(
+		session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(
+			pkcs11.CKM_RSA_PKCS_OAEP,
+			pkcs11.NewOAEPParams(hashMech, mgfMech, pkcs11.CKZ_DATA_SPECIFIED, opts.Label),
+		)},
+		privateKey,
+	); err != nil {
+		return nil, err
+	}
+	return s.context.Decrypt(session, msg)
+}
@@ -0,0 +1,62 @@
+package pksigner
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestSaltLengthForModulus(t *testing.T) {
+	cases := []struct {
+		name    string
+		modBits int
+		hash    crypto.Hash
+		want    uint
+	}{
+		{"2048-bit modulus, SHA-256", 2048, crypto.SHA256, 222},
+		{"1024-bit modulus, SHA-1", 1024, crypto.SHA1, 106},
+	}
+	for _, c := range cases {
+		got, err := saltLengthForModulus(c.modBits, c.hash)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: saltLengthForModulus(%d, %v) = %d, want %d", c.name, c.modBits, c.hash, got, c.want)
+		}
+	}
+}
+
+func TestSaltLengthForModulusTooSmall(t *testing.T) {
+	if _, err := saltLengthForModulus(128, crypto.SHA512); err == nil {
+		t.Fatal("expected an error for a modulus too small to hold the hash plus PSS padding")
+	}
+}
+
+func TestSaltLength(t *testing.T) {
+	cases := []struct {
+		name      string
+		hash      crypto.Hash
+		requested int
+		want      uint
+	}{
+		{"equals hash", crypto.SHA256, rsa.PSSSaltLengthEqualsHash, 32},
+		{"explicit length", crypto.SHA256, 20, 20},
+		{"explicit length, single byte", crypto.SHA256, 1, 1},
+	}
+	for _, c := range cases {
+		got, err := saltLength(c.hash, c.requested)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: saltLength(%v, %d) = %d, want %d", c.name, c.hash, c.requested, got, c.want)
+		}
+	}
+}
+
+func TestSaltLengthNegative(t *testing.T) {
+	if _, err := saltLength(crypto.SHA256, -2); err == nil {
+		t.Fatal("expected an error for a negative, non-sentinel salt length")
+	}
+}
@@ -0,0 +1,128 @@
+package pksigner
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPercentDecode(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"mytoken", "mytoken"},
+		{"PIV%20AUTH%20key", "PIV AUTH key"},
+		{"100%25", "100%"},
+		{"a+b", "a+b"}, // unlike net/url, '+' is left alone
+	}
+	for _, c := range cases {
+		got, err := percentDecode(c.in)
+		if err != nil {
+			t.Fatalf("percentDecode(%q): %s", c.in, err)
+		}
+		if string(got) != c.want {
+			t.Fatalf("percentDecode(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestPercentDecodeBinary(t *testing.T) {
+	got, err := percentDecode("%00%01%ff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x00, 0x01, 0xff}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("percentDecode binary = %x, want %x", got, want)
+	}
+}
+
+func TestPercentDecodeTruncated(t *testing.T) {
+	if _, err := percentDecode("foo%2"); err == nil {
+		t.Fatal("expected an error for a truncated percent-encoding")
+	}
+}
+
+func TestPercentDecodeInvalidHex(t *testing.T) {
+	if _, err := percentDecode("foo%zz"); err == nil {
+		t.Fatal("expected an error for an invalid percent-encoding")
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	uri := "pkcs11:token=mytoken;manufacturer=Yubico;serial=12345;object=PIV%20AUTH%20key;type=private;id=%01%02?module-path=/usr/lib/softhsm2.so&pin-value=123456"
+
+	config, err := ParseURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.TokenLabel != "mytoken" {
+		t.Errorf("TokenLabel = %q, want %q", config.TokenLabel, "mytoken")
+	}
+	if config.Manufacturer != "Yubico" {
+		t.Errorf("Manufacturer = %q, want %q", config.Manufacturer, "Yubico")
+	}
+	if config.Serial != "12345" {
+		t.Errorf("Serial = %q, want %q", config.Serial, "12345")
+	}
+	if config.PrivateKeyLabel != "PIV AUTH key" {
+		t.Errorf("PrivateKeyLabel = %q, want %q", config.PrivateKeyLabel, "PIV AUTH key")
+	}
+	if config.CertificateLabel != "" {
+		t.Errorf("CertificateLabel = %q, want empty", config.CertificateLabel)
+	}
+	if !bytes.Equal(config.ID, []byte{0x01, 0x02}) {
+		t.Errorf("ID = %x, want %x", config.ID, []byte{0x01, 0x02})
+	}
+	if config.Module != "/usr/lib/softhsm2.so" {
+		t.Errorf("Module = %q, want %q", config.Module, "/usr/lib/softhsm2.so")
+	}
+
+	static, ok := config.PinRetriever.(StaticPin)
+	if !ok {
+		t.Fatalf("PinRetriever = %T, want StaticPin", config.PinRetriever)
+	}
+	if string(static) != "123456" {
+		t.Errorf("PinRetriever = %q, want %q", static, "123456")
+	}
+}
+
+func TestParseURICertificateType(t *testing.T) {
+	config, err := ParseURI("pkcs11:object=Certificate%20for%20PIV%20Authentication;type=cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.CertificateLabel != "Certificate for PIV Authentication" {
+		t.Errorf("CertificateLabel = %q, want %q", config.CertificateLabel, "Certificate for PIV Authentication")
+	}
+	if config.PrivateKeyLabel != "" {
+		t.Errorf("PrivateKeyLabel = %q, want empty", config.PrivateKeyLabel)
+	}
+}
+
+func TestParseURIPinSource(t *testing.T) {
+	config, err := ParseURI("pkcs11:token=mytoken?pin-source=file:/etc/pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, ok := config.PinRetriever.(FilePin)
+	if !ok {
+		t.Fatalf("PinRetriever = %T, want FilePin", config.PinRetriever)
+	}
+	if string(file) != "/etc/pin" {
+		t.Errorf("FilePin = %q, want %q", file, "/etc/pin")
+	}
+}
+
+func TestParseURIRejectsWrongScheme(t *testing.T) {
+	if _, err := ParseURI("http://example.com"); err == nil {
+		t.Fatal("expected an error for a non-pkcs11 URI")
+	}
+}
+
+func TestParseURIRejectsMalformedAttribute(t *testing.T) {
+	if _, err := ParseURI("pkcs11:token"); err == nil {
+		t.Fatal("expected an error for an attribute missing '='")
+	}
+}